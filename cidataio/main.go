@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
-	"time"
+
+	diskfs "github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/disk"
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -15,49 +18,45 @@ const (
 	configNetworkConfigPath = "network-config"
 	configMetaDataPath      = "meta-data"
 	configUserDataPath      = "user-data"
-)
 
-// run is a helper to run a shell command and log it.
-func run(cmdStr string, args ...string) {
-	log.Printf("Running: %s %s", cmdStr, strings.Join(args, " "))
-	cmd := exec.Command(cmdStr, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		log.Fatalf("Command failed: %v", err)
-	}
-}
+	// cidataPartitionSize is the size, in bytes, of the partition created to
+	// hold the cidata filesystem.
+	cidataPartitionSize = 8 * 1024 * 1024
+
+	// BLKRRPART is the ioctl request to re-read partition table (Linux-specific).
+	BLKRRPART = 0x125f
+)
 
-// runWithOutput runs a command and returns its stdout.
-func runWithOutput(cmdStr string, args ...string) string {
-	log.Printf("Running (for output): %s %s", cmdStr, strings.Join(args, " "))
-	out, err := exec.Command(cmdStr, args...).CombinedOutput()
+// addCidataPartition appends a fixed-size Microsoft Basic Data partition to
+// d's GPT and writes the table back, returning the new partition's 1-indexed
+// number.
+func addCidataPartition(d *disk.Disk) (int, error) {
+	table, err := d.GetPartitionTable()
 	if err != nil {
-		log.Printf("Command failed: %s - %v", string(out), err)
-		// Don't fatalf, as some commands (like ls) might fail gracefully
+		return 0, fmt.Errorf("failed to read partition table: %w", err)
 	}
-	return strings.TrimSpace(string(out))
-}
 
-// findNewPartition compares a list of partitions before and after an operation.
-func findNewPartition(before, after string) string {
-	beforeSet := make(map[string]bool)
-	for _, p := range strings.Split(before, "\n") {
-		if p != "" {
-			beforeSet[p] = true
-		}
+	gptTable, ok := table.(*gpt.Table)
+	if !ok {
+		return 0, fmt.Errorf("disk does not have a GPT partition table")
 	}
 
-	for _, p := range strings.Split(after, "\n") {
-		if p != "" && !beforeSet[p] {
-			return p // Found the new one
-		}
+	gptTable.Partitions = append(gptTable.Partitions, &gpt.Partition{
+		Type: gpt.MicrosoftBasicData,
+		Name: configISOLabel,
+		Size: cidataPartitionSize,
+	})
+	partNum := len(gptTable.Partitions)
+
+	if err := d.Partition(gptTable); err != nil {
+		return 0, fmt.Errorf("failed to write partition table: %w", err)
 	}
-	return ""
+
+	return partNum, nil
 }
 
-// writeFileIfEnv writes content from an env var to a file.
-func writeFileIfEnv(envVar, path string) {
+// writeFileIfEnv writes the content of an env var to path on fs.
+func writeFileIfEnv(fs filesystem.FileSystem, envVar, path string) {
 	content := os.Getenv(envVar)
 	if content == "" {
 		log.Printf("Env var %s not set, skipping file.", envVar)
@@ -65,8 +64,13 @@ func writeFileIfEnv(envVar, path string) {
 	}
 
 	log.Printf("Writing content from %s to %s", envVar, path)
-	err := os.WriteFile(path, []byte(content), 0644)
+	f, err := fs.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC)
 	if err != nil {
+		log.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte(content)); err != nil {
 		log.Fatalf("Failed to write file %s: %v", path, err)
 	}
 }
@@ -74,55 +78,44 @@ func writeFileIfEnv(envVar, path string) {
 func main() {
 	log.Println("Starting cidataio action...")
 
-	// 1. Get DEST_DISK
-	disk := os.Getenv("DEST_DISK")
-	if disk == "" {
+	diskPath := os.Getenv("DEST_DISK")
+	if diskPath == "" {
 		log.Fatalf("DEST_DISK environment variable not set.")
 	}
 
-	// 2. Force kernel to read partition table and get "before" list
-	run("partprobe", disk)
-	time.Sleep(1 * time.Second) // Give udev time to create devices
-
-	// List all partitions for this disk using regex to match both:
-	// - Standard devices: /dev/sda1, /dev/sdb2, /dev/vda3
-	// - NVMe/MMC devices: /dev/nvme0n1p1, /dev/mmcblk0p2
-	globPattern := fmt.Sprintf("ls -1 %s* 2>/dev/null | grep -E '%sp?[0-9]+$' || true", disk, disk)
-	partsBefore := runWithOutput("sh", "-c", globPattern)
-
-	// 3. Create the new partition
-	log.Printf("Creating new partition on %s", disk)
-	run("sgdisk", "-n", "0:0:0", "-t", "0:0700", disk)
-
-	// 4. Force kernel to re-read and find the new partition
-	run("partprobe", disk)
-	time.Sleep(2 * time.Second) // Give udev time to settle
-	partsAfter := runWithOutput("sh", "-c", globPattern)
-
-	newPart := findNewPartition(partsBefore, partsAfter)
-	if newPart == "" {
-		log.Fatalf("Could not find a new partition. Before: [%s], After: [%s]", partsBefore, partsAfter)
+	d, err := diskfs.Open(diskPath)
+	if err != nil {
+		log.Fatalf("Failed to open disk %s: %v", diskPath, err)
 	}
-	log.Printf("Found new partition: %s", newPart)
-
-	// 5. Format the new partition
-	log.Printf("Formatting %s as vfat with label cidata", newPart)
-	run("mkfs.vfat", "-n", configISOLabel, newPart)
+	defer d.File.Close()
 
-	// 6. Mount, Write, Unmount
-	mountPoint := "/mnt/cidata"
-	log.Printf("Mounting %s to %s", newPart, mountPoint)
-	run("mkdir", "-p", mountPoint)
-	run("mount", newPart, mountPoint)
+	log.Printf("Creating new partition on %s", diskPath)
+	partNum, err := addCidataPartition(d)
+	if err != nil {
+		log.Fatalf("Failed to create partition: %v", err)
+	}
+	log.Printf("Created partition %d", partNum)
+
+	log.Printf("Formatting partition %d as vfat with label %s", partNum, configISOLabel)
+	fs, err := d.CreateFilesystem(disk.FilesystemSpec{
+		Partition:   partNum,
+		FSType:      filesystem.TypeFat32,
+		VolumeLabel: configISOLabel,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create filesystem: %v", err)
+	}
 
-	// 7. Write data from Env Vars
-	writeFileIfEnv("USER_DATA", filepath.Join(mountPoint, configUserDataPath))
-	writeFileIfEnv("META_DATA", filepath.Join(mountPoint, configMetaDataPath))
-	writeFileIfEnv("NETWORK_CONFIG", filepath.Join(mountPoint, configNetworkConfigPath))
+	writeFileIfEnv(fs, "USER_DATA", filepath.Join("/", configUserDataPath))
+	writeFileIfEnv(fs, "META_DATA", filepath.Join("/", configMetaDataPath))
+	writeFileIfEnv(fs, "NETWORK_CONFIG", filepath.Join("/", configNetworkConfigPath))
 
-	// 8. Unmount
-	log.Printf("Unmounting %s", mountPoint)
-	run("umount", mountPoint)
+	if err := d.File.Sync(); err != nil {
+		log.Printf("Warning: failed to sync disk: %v", err)
+	}
+	if err := unix.IoctlSetInt(int(d.File.Fd()), BLKRRPART, 0); err != nil {
+		log.Printf("Warning: failed to re-probe partitions for %s: %v", diskPath, err)
+	}
 
 	log.Println("cidataio action completed successfully.")
-}
\ No newline at end of file
+}
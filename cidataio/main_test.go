@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	diskfs "github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/disk"
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+)
+
+// newTestDisk creates a sparse-file disk of size bytes with an empty GPT
+// partition table, mimicking an image that oci2disk has already written.
+func newTestDisk(t *testing.T, size int64) *disk.Disk {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "disk.img")
+	d, err := diskfs.Create(path, size, diskfs.Raw, diskfs.SectorSizeDefault)
+	if err != nil {
+		t.Fatalf("diskfs.Create() error = %v", err)
+	}
+	t.Cleanup(func() { d.File.Close() })
+
+	if err := d.Partition(&gpt.Table{}); err != nil {
+		t.Fatalf("failed to write empty partition table: %v", err)
+	}
+	return d
+}
+
+func TestAddCidataPartition(t *testing.T) {
+	d := newTestDisk(t, 32*1024*1024)
+
+	partNum, err := addCidataPartition(d)
+	if err != nil {
+		t.Fatalf("addCidataPartition() error = %v", err)
+	}
+	if partNum != 1 {
+		t.Errorf("partNum = %d, want 1", partNum)
+	}
+
+	table, err := d.GetPartitionTable()
+	if err != nil {
+		t.Fatalf("GetPartitionTable() error = %v", err)
+	}
+	gptTable, ok := table.(*gpt.Table)
+	if !ok {
+		t.Fatalf("table is %T, want *gpt.Table", table)
+	}
+	if len(gptTable.Partitions) != 1 {
+		t.Fatalf("len(Partitions) = %d, want 1", len(gptTable.Partitions))
+	}
+	if gptTable.Partitions[0].Type != gpt.MicrosoftBasicData {
+		t.Errorf("Partitions[0].Type = %s, want %s", gptTable.Partitions[0].Type, gpt.MicrosoftBasicData)
+	}
+}
+
+func TestAddCidataPartition_appendsAfterExisting(t *testing.T) {
+	d := newTestDisk(t, 32*1024*1024)
+
+	table, err := d.GetPartitionTable()
+	if err != nil {
+		t.Fatalf("GetPartitionTable() error = %v", err)
+	}
+	gptTable := table.(*gpt.Table)
+	gptTable.Partitions = append(gptTable.Partitions, &gpt.Partition{
+		Type: gpt.LinuxFilesystem,
+		Name: "root",
+		Size: 8 * 1024 * 1024,
+	})
+	if err := d.Partition(gptTable); err != nil {
+		t.Fatalf("failed to write partition table: %v", err)
+	}
+
+	partNum, err := addCidataPartition(d)
+	if err != nil {
+		t.Fatalf("addCidataPartition() error = %v", err)
+	}
+	if partNum != 2 {
+		t.Errorf("partNum = %d, want 2", partNum)
+	}
+}
+
+func TestCidataFilesystemRoundTrip(t *testing.T) {
+	d := newTestDisk(t, 32*1024*1024)
+
+	partNum, err := addCidataPartition(d)
+	if err != nil {
+		t.Fatalf("addCidataPartition() error = %v", err)
+	}
+
+	fs, err := d.CreateFilesystem(disk.FilesystemSpec{
+		Partition:   partNum,
+		FSType:      filesystem.TypeFat32,
+		VolumeLabel: configISOLabel,
+	})
+	if err != nil {
+		t.Fatalf("CreateFilesystem() error = %v", err)
+	}
+
+	t.Setenv("USER_DATA", "#cloud-config\nhostname: test\n")
+	writeFileIfEnv(fs, "USER_DATA", filepath.Join("/", configUserDataPath))
+
+	f, err := fs.OpenFile(filepath.Join("/", configUserDataPath), os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	defer f.Close()
+
+	got := make([]byte, 64)
+	n, _ := f.Read(got)
+	if string(got[:n]) != "#cloud-config\nhostname: test\n" {
+		t.Errorf("file content = %q, want %q", got[:n], "#cloud-config\nhostname: test\n")
+	}
+}
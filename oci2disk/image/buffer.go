@@ -0,0 +1,83 @@
+package image
+
+// layerBuffer captures a single layer's verified, decompressed content so
+// a fetch worker can finish independently of when the writer goroutine
+// reaches that layer's turn. Content is kept in memory up to
+// layerBufferMemLimit; beyond that it spills to a temp file so a fast
+// fetcher waiting on a slow writer can't exhaust memory.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// layerBufferMemLimit is the amount of a layer's content kept in memory
+// before a layerBuffer spills the remainder to a temp file.
+const layerBufferMemLimit = 64 * 1024 * 1024
+
+type layerBuffer struct {
+	mem   []byte
+	spill *os.File
+}
+
+// newLayerBuffer returns an empty layerBuffer ready for Write.
+func newLayerBuffer() *layerBuffer {
+	return &layerBuffer{}
+}
+
+// Write implements io.Writer, buffering in memory until layerBufferMemLimit
+// is reached and spilling to a temp file beyond that.
+func (b *layerBuffer) Write(p []byte) (int, error) {
+	if b.spill == nil && len(b.mem)+len(p) > layerBufferMemLimit {
+		f, err := os.CreateTemp("", "oci2disk-layer-*")
+		if err != nil {
+			return 0, fmt.Errorf("failed to create layer spill file: %w", err)
+		}
+		if _, err := f.Write(b.mem); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return 0, fmt.Errorf("failed to spill buffered layer content: %w", err)
+		}
+		b.mem = nil
+		b.spill = f
+	}
+
+	if b.spill != nil {
+		n, err := b.spill.Write(p)
+		if err != nil {
+			return n, fmt.Errorf("failed to write to layer spill file: %w", err)
+		}
+		return n, nil
+	}
+
+	b.mem = append(b.mem, p...)
+	return len(p), nil
+}
+
+// Reader returns a reader over the buffered content from the beginning,
+// regardless of how much has already been read from a previous call.
+func (b *layerBuffer) Reader() (io.Reader, error) {
+	if b.spill == nil {
+		return bytes.NewReader(b.mem), nil
+	}
+	if _, err := b.spill.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind layer spill file: %w", err)
+	}
+	return b.spill, nil
+}
+
+// Close releases the temp file backing a spilled buffer, if any. It is a
+// no-op for buffers that never spilled.
+func (b *layerBuffer) Close() error {
+	if b.spill == nil {
+		return nil
+	}
+	name := b.spill.Name()
+	err := b.spill.Close()
+	if rmErr := os.Remove(name); err == nil {
+		err = rmErr
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package image
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func Test_layerBuffer_memory(t *testing.T) {
+	b := newLayerBuffer()
+	defer b.Close()
+
+	data := []byte("YourDataHere")
+	if _, err := b.Write(data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if b.spill != nil {
+		t.Fatalf("spill = %v, want nil for content under layerBufferMemLimit", b.spill)
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		t.Fatalf("Reader() error = %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Reader() = %q, want %q", got, data)
+	}
+}
+
+func Test_layerBuffer_spill(t *testing.T) {
+	b := newLayerBuffer()
+	defer b.Close()
+
+	data := bytes.Repeat([]byte{'x'}, layerBufferMemLimit+1)
+	if _, err := b.Write(data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if b.spill == nil {
+		t.Fatal("spill = nil, want a spill file for content over layerBufferMemLimit")
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		t.Fatalf("Reader() error = %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("Reader() content did not round-trip through the spill file")
+	}
+
+	// Reader must be rewindable so a caller can read it more than once.
+	r2, err := b.Reader()
+	if err != nil {
+		t.Fatalf("Reader() error = %v", err)
+	}
+	n, err := io.Copy(io.Discard, r2)
+	if err != nil {
+		t.Fatalf("second Reader() copy error = %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("second Reader() length = %d, want %d", n, len(data))
+	}
+}
@@ -0,0 +1,148 @@
+package image
+
+// This file pipelines multi-layer fetches so network fetch, decompression,
+// and disk writes can overlap instead of running one layer at a time. Up
+// to Options.FetchConcurrency layers are fetched, verified, and
+// decompressed concurrently into layerBuffers, while a single goroutine
+// drains the buffers into fileOut strictly in manifest order, so the
+// on-disk layout matches the manifest regardless of which layer's fetch
+// finishes first.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	log "github.com/sirupsen/logrus"
+	"oras.land/oras-go/v2"
+)
+
+// fetchResult is one layer's outcome, handed from a fetch worker to the
+// writer loop through that layer's slot.
+type fetchResult struct {
+	buf     *layerBuffer
+	written int64
+	err     error
+}
+
+// fetchLayersToDevice fetches layers with up to concurrency workers and
+// writes their verified, decompressed content into fileOut in manifest
+// order. It returns the total number of decompressed bytes written.
+func fetchLayersToDevice(ctx context.Context, src oras.ReadOnlyTarget, fileOut *os.File, layers []ocispec.Descriptor, opts Options, concurrency int) (int64, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// Each layer gets its own buffered (capacity 1) result slot so a
+	// worker can finish and hand off its buffer without waiting for the
+	// writer loop below to reach its turn.
+	results := make([]chan fetchResult, len(layers))
+	for i := range results {
+		results[i] = make(chan fetchResult, 1)
+	}
+
+	// consumed[i] is closed once the writer loop below has finished with
+	// layer i. A worker for layer i >= concurrency waits on consumed[i-
+	// concurrency] before fetching, so at most `concurrency` layers can
+	// ever be fully fetched and sitting in memory/spill ahead of the
+	// writer, regardless of how far behind the writer falls.
+	consumed := make([]chan struct{}, len(layers))
+	for i := range consumed {
+		consumed[i] = make(chan struct{})
+	}
+
+	// Workers for layer i >= concurrency block until consumed[i-concurrency]
+	// is closed, which only happens once the writer loop below has run. So
+	// launching must not block the writer loop's goroutine: it runs in its
+	// own goroutine, concurrently with the writer loop, rather than upfront.
+	sem := make(chan struct{}, concurrency)
+	go func() {
+		for i, layer := range layers {
+			i, layer := i, layer
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem }()
+				if i >= concurrency {
+					<-consumed[i-concurrency]
+				}
+				buf, written, err := fetchLayerWithRetry(ctx, src, layer, opts)
+				results[i] <- fetchResult{buf: buf, written: written, err: err}
+			}()
+		}
+	}()
+
+	var totalBytes int64
+	for i, layer := range layers {
+		res := <-results[i]
+		if res.err != nil {
+			close(consumed[i])
+			drainRemaining(results[i+1:], consumed[i+1:])
+			return totalBytes, fmt.Errorf("failed to fetch layer %s: %w", layer.Digest, res.err)
+		}
+
+		r, err := res.buf.Reader()
+		if err != nil {
+			res.buf.Close()
+			close(consumed[i])
+			drainRemaining(results[i+1:], consumed[i+1:])
+			return totalBytes, fmt.Errorf("failed to read buffered layer %s: %w", layer.Digest, err)
+		}
+		if _, err := io.Copy(fileOut, r); err != nil {
+			res.buf.Close()
+			close(consumed[i])
+			drainRemaining(results[i+1:], consumed[i+1:])
+			return totalBytes, fmt.Errorf("failed to write layer %s to device: %w", layer.Digest, err)
+		}
+		res.buf.Close()
+		close(consumed[i])
+
+		totalBytes += res.written
+		log.Infof("Wrote layer %s (%s) to disk", layer.Digest, prettyByteSize(res.written))
+	}
+
+	return totalBytes, nil
+}
+
+// drainRemaining receives and discards the results for layers the writer
+// loop never reached after an earlier layer failed. It closes each
+// buffer that did complete, so any spilled oci2disk-layer-* temp file is
+// removed, and closes each consumed slot so fetch workers still waiting
+// on an earlier slot can proceed and exit instead of leaking.
+func drainRemaining(results []chan fetchResult, consumed []chan struct{}) {
+	for i, resCh := range results {
+		res := <-resCh
+		if res.buf != nil {
+			res.buf.Close()
+		}
+		close(consumed[i])
+	}
+}
+
+// fetchLayerWithRetry fetches, verifies, and decompresses a single layer
+// into a fresh layerBuffer, retrying the whole attempt with a new buffer
+// on transient errors.
+func fetchLayerWithRetry(ctx context.Context, src oras.ReadOnlyTarget, layer ocispec.Descriptor, opts Options) (*layerBuffer, int64, error) {
+	var buf *layerBuffer
+	var written int64
+
+	err := withRetry(ctx, opts, fmt.Sprintf("fetch layer %s", layer.Digest), func() error {
+		if buf != nil {
+			buf.Close()
+		}
+		buf = newLayerBuffer()
+
+		n, fetchErr := fetchLayerToWriter(ctx, src, buf, layer)
+		written = n
+		return fetchErr
+	})
+	if err != nil {
+		if buf != nil {
+			buf.Close()
+		}
+		return nil, 0, err
+	}
+
+	return buf, written, nil
+}
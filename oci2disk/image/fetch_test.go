@@ -0,0 +1,259 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/ulikunitz/xz"
+)
+
+// stubRegistry is a minimal oras.ReadOnlyTarget backed by a map of blobs,
+// with an optional artificial delay per blob so tests can make layers
+// finish fetching out of manifest order.
+type stubRegistry struct {
+	blobs map[digest.Digest][]byte
+	delay map[digest.Digest]time.Duration
+}
+
+func (s *stubRegistry) Fetch(_ context.Context, target ocispec.Descriptor) (io.ReadCloser, error) {
+	b, ok := s.blobs[target.Digest]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found", target.Digest)
+	}
+	if d := s.delay[target.Digest]; d > 0 {
+		time.Sleep(d)
+	}
+	return io.NopCloser(newByteReader(b)), nil
+}
+
+func (s *stubRegistry) Exists(_ context.Context, target ocispec.Descriptor) (bool, error) {
+	_, ok := s.blobs[target.Digest]
+	return ok, nil
+}
+
+func (s *stubRegistry) Resolve(_ context.Context, _ string) (ocispec.Descriptor, error) {
+	return ocispec.Descriptor{}, fmt.Errorf("not implemented")
+}
+
+func newByteReader(b []byte) io.Reader {
+	return &sliceReader{data: b}
+}
+
+type sliceReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+func layerDescriptor(content []byte, name string) ocispec.Descriptor {
+	return ocispec.Descriptor{
+		MediaType: "application/vnd.oci.image.layer.v1.tar",
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+		Annotations: map[string]string{
+			ocispec.AnnotationTitle: name + ".tar",
+		},
+	}
+}
+
+func Test_fetchLayersToDevice_preservesManifestOrder(t *testing.T) {
+	// layer "a" is the slowest to fetch but must still land first on disk,
+	// since it is first in manifest order.
+	a := []byte("AAAAAAAAAA")
+	b := []byte("BBBBBBBBBB")
+	c := []byte("CCCCCCCCCC")
+
+	layers := []ocispec.Descriptor{
+		layerDescriptor(a, "a"),
+		layerDescriptor(b, "b"),
+		layerDescriptor(c, "c"),
+	}
+	// A title annotation makes fetchLayerToWriter pick a decompressor from
+	// its suffix, and findDecompressor rejects ".tar", so drop the title
+	// annotation entirely to exercise the uncompressed path.
+	for i := range layers {
+		layers[i].Annotations = nil
+	}
+
+	reg := &stubRegistry{
+		blobs: map[digest.Digest][]byte{
+			layers[0].Digest: a,
+			layers[1].Digest: b,
+			layers[2].Digest: c,
+		},
+		delay: map[digest.Digest]time.Duration{
+			layers[0].Digest: 30 * time.Millisecond,
+		},
+	}
+
+	fileOut, err := os.CreateTemp(t.TempDir(), "disk-*.img")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	defer fileOut.Close()
+
+	total, err := fetchLayersToDevice(context.Background(), reg, fileOut, layers, Options{}, 3)
+	if err != nil {
+		t.Fatalf("fetchLayersToDevice() error = %v", err)
+	}
+	want := int64(len(a) + len(b) + len(c))
+	if total != want {
+		t.Errorf("total = %d, want %d", total, want)
+	}
+
+	got, err := os.ReadFile(fileOut.Name())
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	wantContent := append(append(append([]byte{}, a...), b...), c...)
+	if string(got) != string(wantContent) {
+		t.Errorf("disk content = %q, want %q", got, wantContent)
+	}
+}
+
+func Test_fetchLayersToDevice_moreLayersThanConcurrency(t *testing.T) {
+	// Regression test: with len(layers) > 2*concurrency, workers for later
+	// layers park waiting for the writer loop to consume an earlier layer
+	// before the launch loop has dispatched every worker, which used to
+	// deadlock (launch loop blocked on sem, writer loop never started).
+	contents := [][]byte{
+		[]byte("AAAAAAAAAA"),
+		[]byte("BBBBBBBBBB"),
+		[]byte("CCCCCCCCCC"),
+		[]byte("DDDDDDDDDD"),
+		[]byte("EEEEEEEEEE"),
+	}
+
+	layers := make([]ocispec.Descriptor, len(contents))
+	blobs := make(map[digest.Digest][]byte, len(contents))
+	for i, c := range contents {
+		layers[i] = layerDescriptor(c, fmt.Sprintf("l%d", i))
+		layers[i].Annotations = nil
+		blobs[layers[i].Digest] = c
+	}
+
+	reg := &stubRegistry{blobs: blobs}
+
+	fileOut, err := os.CreateTemp(t.TempDir(), "disk-*.img")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	defer fileOut.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := fetchLayersToDevice(context.Background(), reg, fileOut, layers, Options{}, 2)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("fetchLayersToDevice() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetchLayersToDevice() did not return, deadlocked")
+	}
+
+	got, err := os.ReadFile(fileOut.Name())
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var want []byte
+	for _, c := range contents {
+		want = append(want, c...)
+	}
+	if string(got) != string(want) {
+		t.Errorf("disk content = %q, want %q", got, want)
+	}
+}
+
+func Test_fetchLayersToDevice_digestMismatchStopsWrite(t *testing.T) {
+	a := []byte("AAAAAAAAAA")
+	layers := []ocispec.Descriptor{layerDescriptor(a, "a")}
+	layers[0].Annotations = nil
+
+	reg := &stubRegistry{
+		blobs: map[digest.Digest][]byte{
+			layers[0].Digest: []byte("tampered!!"),
+		},
+	}
+
+	fileOut, err := os.CreateTemp(t.TempDir(), "disk-*.img")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	defer fileOut.Close()
+
+	opts := Options{MaxElapsedTime: 10 * time.Millisecond, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	if _, err := fetchLayersToDevice(context.Background(), reg, fileOut, layers, opts, 1); err == nil {
+		t.Fatal("fetchLayersToDevice() error = nil, want digest mismatch error")
+	}
+	if info, err := fileOut.Stat(); err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	} else if info.Size() != 0 {
+		t.Errorf("device size = %d, want 0 (nothing written for a tampered layer)", info.Size())
+	}
+}
+
+func Test_fetchLayersToDevice_digestMismatchStopsWrite_xz(t *testing.T) {
+	// Regression test: xz's reader can finish decoding a valid stream
+	// without ever reading its underlying digestingReader to EOF, so a
+	// tampered layer must still be caught, not just gzip's.
+	xzCompress := func(t *testing.T, s string) []byte {
+		t.Helper()
+		var b bytes.Buffer
+		w, err := xz.NewWriter(&b)
+		if err != nil {
+			t.Fatalf("xz.NewWriter() error = %v", err)
+		}
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+
+	correct := xzCompress(t, "YourDataHere")
+	tampered := xzCompress(t, "OtherDataHere")
+
+	layer := layerDescriptor(correct, "a")
+	layer.Annotations = map[string]string{ocispec.AnnotationTitle: "a.tar.xz"}
+
+	reg := &stubRegistry{
+		blobs: map[digest.Digest][]byte{layer.Digest: tampered},
+	}
+
+	fileOut, err := os.CreateTemp(t.TempDir(), "disk-*.img")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	defer fileOut.Close()
+
+	opts := Options{MaxElapsedTime: 10 * time.Millisecond, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	if _, err := fetchLayersToDevice(context.Background(), reg, fileOut, []ocispec.Descriptor{layer}, opts, 1); err == nil {
+		t.Fatal("fetchLayersToDevice() error = nil, want digest mismatch error")
+	}
+	if info, err := fileOut.Stat(); err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	} else if info.Size() != 0 {
+		t.Errorf("device size = %d, want 0 (nothing written for a tampered layer)", info.Size())
+	}
+}
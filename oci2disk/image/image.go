@@ -7,9 +7,11 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -17,19 +19,65 @@ import (
 	"time"
 
 	"github.com/klauspost/compress/zstd"
+	digest "github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	log "github.com/sirupsen/logrus"
 	"github.com/ulikunitz/xz"
 	"golang.org/x/sys/unix"
 	"oras.land/oras-go/v2"
 	"oras.land/oras-go/v2/content"
-	"oras.land/oras-go/v2/registry/remote"
 	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/retry"
 )
 
 // BLKRRPART is the ioctl request to re-read partition table (Linux-specific)
 const BLKRRPART = 0x125f
 
+// ErrDigestMismatch is returned when a fetched layer's computed digest does
+// not match the digest recorded for it in the manifest.
+var ErrDigestMismatch = errors.New("layer digest mismatch")
+
+// digestingReader wraps a layer's content stream and verifies, once fully
+// consumed, that what was read hashes to the digest the manifest promised.
+// It is modelled on containers/image's digestingReader in copy/blob.go.
+type digestingReader struct {
+	source   io.Reader
+	digester digest.Digester
+	expected digest.Digest
+}
+
+// newDigestingReader returns a reader that tees everything read from source
+// through a hash matching the algorithm of expected, so the digest can be
+// checked once the stream is exhausted.
+func newDigestingReader(source io.Reader, expected digest.Digest) (*digestingReader, error) {
+	if err := expected.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid digest %q: %w", expected, err)
+	}
+	if !expected.Algorithm().Available() {
+		return nil, fmt.Errorf("unsupported digest algorithm %q", expected.Algorithm())
+	}
+	return &digestingReader{
+		source:   source,
+		digester: expected.Algorithm().Digester(),
+		expected: expected,
+	}, nil
+}
+
+func (r *digestingReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	if n > 0 {
+		if _, werr := r.digester.Hash().Write(p[:n]); werr != nil {
+			return n, fmt.Errorf("failed to update digest: %w", werr)
+		}
+	}
+	if err == io.EOF {
+		if actual := r.digester.Digest(); actual != r.expected {
+			return n, fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, r.expected, actual)
+		}
+	}
+	return n, err
+}
+
 type Progress struct {
 	w      io.Writer
 	r      io.Reader
@@ -72,24 +120,77 @@ func prettyByteSize(b int64) string {
 	return fmt.Sprintf("%.6fYiB", bf)
 }
 
+// Options customizes how Write pulls and streams an image.
+type Options struct {
+	// Keychain resolves registry credentials for authenticated pulls. If nil,
+	// NewDefaultKeychain() is used, which understands docker config.json,
+	// credential helpers, and the REGISTRY_USERNAME/REGISTRY_PASSWORD env vars.
+	Keychain auth.CredentialFunc
+
+	// InitialBackoff, MaxBackoff, and MaxElapsedTime override the exponential
+	// backoff applied to retryable registry/blob errors. Zero values fall
+	// back to 1s / 30s / 10m.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	MaxElapsedTime time.Duration
+
+	// FetchConcurrency is the number of layers fetched, verified, and
+	// decompressed concurrently. Zero selects min(4, number of qualifying
+	// layers).
+	FetchConcurrency int
+
+	// Platform selects which manifest to pull when the source resolves to
+	// a manifest index. OS and Architecture default to "linux" and
+	// runtime.GOARCH when left unset. Use ParsePlatform to build this from
+	// a "os/arch[/variant]" string.
+	Platform ocispec.Platform
+}
+
 // Write will pull an image and write it to local storage device
 // Compression type is automatically detected from the layer's org.opencontainers.image.title annotation.
 // Platform is automatically detected from the runtime (linux/arm64, linux/amd64, etc.).
 func Write(sourceImage, destinationDevice string) error {
+	return WriteWithOptions(sourceImage, destinationDevice, Options{})
+}
+
+// WriteWithOptions behaves like Write but allows overriding defaults such as
+// the credentials keychain used for authenticated registry pulls.
+func WriteWithOptions(sourceImage, destinationDevice string, opts Options) error {
 	ctx := context.Background()
 
-	// Detect platform from runtime
-	platformOS := "linux"
-	platformArch := runtime.GOARCH
+	// Default the platform to the runtime's, unless the caller specified
+	// one explicitly (e.g. provisioning an arm64 target from an amd64
+	// worker).
+	wantedPlatform := opts.Platform
+	if wantedPlatform.OS == "" {
+		wantedPlatform.OS = "linux"
+	}
+	if wantedPlatform.Architecture == "" {
+		wantedPlatform.Architecture = runtime.GOARCH
+	}
 
-	// Create repository connection
-	repo, err := remote.NewRepository(sourceImage)
-	if err != nil {
-		return fmt.Errorf("failed to create repository: %w", err)
+	// Configure the registry client with custom HTTP client and credentials;
+	// only used by the docker:// (remote registry) transport.
+	keychain := opts.Keychain
+	if keychain == nil {
+		keychain = NewDefaultKeychain().Resolve
+	}
+	client := &auth.Client{
+		Client:     retry.DefaultClient,
+		Header:     http.Header{"User-Agent": {"oras-go"}},
+		Cache:      auth.DefaultCache,
+		Credential: keychain,
 	}
 
-	// Configure repository client with custom HTTP client
-	repo.Client = auth.DefaultClient
+	// Dispatch to the transport named by the source's prefix: docker://,
+	// oci://, oci-archive://, or a bare reference (treated as docker://).
+	src, err := openSource(ctx, sourceImage, client)
+	if err != nil {
+		return err
+	}
+	if src.ref == "" {
+		return fmt.Errorf("image reference format is invalid. Please specify <name:tag|name@digest>")
+	}
 
 	// Open destination device
 	fileOut, err := os.OpenFile(destinationDevice, os.O_CREATE|os.O_WRONLY, 0o644)
@@ -100,30 +201,45 @@ func Write(sourceImage, destinationDevice string) error {
 
 	log.Infof("Beginning write of image [%s] to disk [%s]", filepath.Base(sourceImage), destinationDevice)
 
-	// Resolve the manifest descriptor with optional platform filtering
-	tagOrDigest := repo.Reference.Reference
-	if tagOrDigest == "" {
-		return fmt.Errorf("image reference format is invalid. Please specify <name:tag|name@digest>")
+	log.Infof("Resolving for platform: %s", platformString(wantedPlatform))
+
+	var rootDescriptor ocispec.Descriptor
+	if err := withRetry(ctx, opts, "resolve manifest", func() error {
+		var resolveErr error
+		rootDescriptor, resolveErr = src.target.Resolve(ctx, src.ref)
+		return resolveErr
+	}); err != nil {
+		return fmt.Errorf("failed to resolve manifest: %w", err)
 	}
 
-	// Configure resolution options with platform filtering if specified
-	resolveOpts := oras.ResolveOptions{}
-	if platformOS != "" && platformArch != "" {
-		resolveOpts.TargetPlatform = &ocispec.Platform{
-			OS:           platformOS,
-			Architecture: platformArch,
+	// If the reference resolves to a manifest index, pick the entry that
+	// best matches wantedPlatform instead of the first match oras' own
+	// resolver would have picked.
+	manifestDescriptor := rootDescriptor
+	if isIndexMediaType(rootDescriptor.MediaType) {
+		var entries []ocispec.Descriptor
+		if err := withRetry(ctx, opts, "fetch manifest index", func() error {
+			var fetchErr error
+			entries, fetchErr = fetchIndexManifests(ctx, src.target, rootDescriptor)
+			return fetchErr
+		}); err != nil {
+			return err
 		}
-		log.Infof("Filtering for platform: %s/%s", platformOS, platformArch)
-	}
 
-	manifestDescriptor, err := oras.Resolve(ctx, repo, tagOrDigest, resolveOpts)
-	if err != nil {
-		return fmt.Errorf("failed to resolve manifest: %w", err)
+		manifestDescriptor, err = selectManifestForPlatform(entries, wantedPlatform)
+		if err != nil {
+			return err
+		}
+		log.Infof("Selected manifest %s for platform %s", manifestDescriptor.Digest, platformString(wantedPlatform))
 	}
 
 	// Fetch the manifest
-	manifestBytes, err := content.FetchAll(ctx, repo, manifestDescriptor)
-	if err != nil {
+	var manifestBytes []byte
+	if err := withRetry(ctx, opts, "fetch manifest", func() error {
+		var fetchErr error
+		manifestBytes, fetchErr = content.FetchAll(ctx, src.target, manifestDescriptor)
+		return fetchErr
+	}); err != nil {
 		return fmt.Errorf("failed to fetch manifest: %w", err)
 	}
 
@@ -133,95 +249,34 @@ func Write(sourceImage, destinationDevice string) error {
 		return fmt.Errorf("failed to parse manifest: %w", err)
 	}
 
-	// Filter and process layers
+	// Filter to the layers we know how to write
 	customMediaType := "application/vnd.oci.image.layer.v1.tar"
-	var totalBytes int64
-	var processedLayers int
-
+	var layers []ocispec.Descriptor
 	for _, layer := range manifest.Layers {
-		// Skip layers that don't match our media type
 		if layer.MediaType != customMediaType {
 			log.Debugf("Skipping layer with media type: %s", layer.MediaType)
 			continue
 		}
+		layers = append(layers, layer)
+	}
+	if len(layers) == 0 {
+		return fmt.Errorf("no layers with media type %s found in manifest", customMediaType)
+	}
 
-		log.Infof("Fetching layer: %s (size: %d bytes)", layer.Digest, layer.Size)
-
-		// Fetch the layer content
-		layerReader, err := repo.Fetch(ctx, layer)
-		if err != nil {
-			return fmt.Errorf("failed to fetch layer %s: %w", layer.Digest, err)
-		}
-
-		// Determine compression and create appropriate reader
-		var sourceReader io.Reader = layerReader
-		var decompressor io.ReadCloser
-
-		// Determine compression type from annotation
-		if layer.Annotations != nil {
-			if titleAnnotation, ok := layer.Annotations[ocispec.AnnotationTitle]; ok {
-				// Create decompressor if needed
-				var err error
-				decompressor, err = findDecompressor(titleAnnotation, layerReader)
-				if err != nil {
-					layerReader.Close()
-					return fmt.Errorf("failed to create decompressor: %w", err)
-				}
-				sourceReader = decompressor
-			}
-		}
-
-		// Create progress tracker that wraps the writer and source reader
-		progress := NewProgress(fileOut, sourceReader)
-
-		// Start progress reporting
-		ticker := time.NewTicker(5 * time.Second)
-		done := make(chan bool)
-		go func() {
-			layerSize := layer.Size
-			for {
-				select {
-				case <-done:
-					log.Infof("Progress: written=%s, compressed=%s, read=%s",
-						prettyByteSize(progress.writeBytes()),
-						prettyByteSize(layerSize),
-						prettyByteSize(progress.readBytes()))
-					return
-				case <-ticker.C:
-					log.Infof("Progress: written=%s, compressed=%s, read=%s",
-						prettyByteSize(progress.writeBytes()),
-						prettyByteSize(layerSize),
-						prettyByteSize(progress.readBytes()))
-				}
-			}
-		}()
-
-		// Copy to destination device: read from progress (which reads from sourceReader) and write to progress
-		_, err = io.Copy(progress, progress)
-
-		// Stop progress reporting
-		ticker.Stop()
-		done <- true
-		
-		// Close in correct order: decompressor first (if exists), then underlying layerReader
-		if decompressor != nil {
-			decompressor.Close()
-		}
-		layerReader.Close()
-
-		if err != nil {
-			return fmt.Errorf("failed to write layer to device: %w", err)
+	concurrency := opts.FetchConcurrency
+	if concurrency <= 0 {
+		concurrency = len(layers)
+		if concurrency > 4 {
+			concurrency = 4
 		}
-
-		totalBytes += progress.writeBytes()
-		processedLayers++
 	}
 
-	if processedLayers == 0 {
-		return fmt.Errorf("no layers with media type %s found in manifest", customMediaType)
+	totalBytes, err := fetchLayersToDevice(ctx, src.target, fileOut, layers, opts, concurrency)
+	if err != nil {
+		return err
 	}
 
-	log.Infof("Successfully processed %d layer(s), total: %s", processedLayers, prettyByteSize(totalBytes))
+	log.Infof("Successfully processed %d layer(s), total: %s", len(layers), prettyByteSize(totalBytes))
 
 	// Do the equivalent of partprobe on the device
 	if err := fileOut.Sync(); err != nil {
@@ -235,6 +290,95 @@ func Write(sourceImage, destinationDevice string) error {
 	return nil
 }
 
+// fetchLayerToWriter fetches a single layer, verifies its digest, decompresses
+// it if needed, and streams it into out. It returns the number of
+// decompressed bytes written so the caller can total them across layers and
+// retries.
+func fetchLayerToWriter(ctx context.Context, src oras.ReadOnlyTarget, out io.Writer, layer ocispec.Descriptor) (int64, error) {
+	log.Infof("Fetching layer: %s (size: %d bytes)", layer.Digest, layer.Size)
+
+	// Fetch the layer content
+	layerReader, err := src.Fetch(ctx, layer)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch layer %s: %w", layer.Digest, err)
+	}
+	defer layerReader.Close()
+
+	// Verify what we receive against the manifest's digest as it streams by
+	digestReader, err := newDigestingReader(layerReader, layer.Digest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to verify layer %s: %w", layer.Digest, err)
+	}
+
+	// Determine compression and create appropriate reader
+	var sourceReader io.Reader = digestReader
+	var decompressor io.ReadCloser
+
+	// Determine compression type from annotation
+	if layer.Annotations != nil {
+		if titleAnnotation, ok := layer.Annotations[ocispec.AnnotationTitle]; ok {
+			// Create decompressor if needed
+			decompressor, err = findDecompressor(titleAnnotation, digestReader)
+			if err != nil {
+				return 0, fmt.Errorf("failed to create decompressor: %w", err)
+			}
+			sourceReader = decompressor
+		}
+	}
+	// Close in correct order: decompressor first (if exists), then underlying layerReader
+	if decompressor != nil {
+		defer decompressor.Close()
+	}
+
+	// Create progress tracker that wraps the writer and source reader
+	progress := NewProgress(out, sourceReader)
+
+	// Start progress reporting
+	ticker := time.NewTicker(5 * time.Second)
+	done := make(chan bool)
+	go func() {
+		layerSize := layer.Size
+		for {
+			select {
+			case <-done:
+				log.Infof("Progress: written=%s, compressed=%s, read=%s",
+					prettyByteSize(progress.writeBytes()),
+					prettyByteSize(layerSize),
+					prettyByteSize(progress.readBytes()))
+				return
+			case <-ticker.C:
+				log.Infof("Progress: written=%s, compressed=%s, read=%s",
+					prettyByteSize(progress.writeBytes()),
+					prettyByteSize(layerSize),
+					prettyByteSize(progress.readBytes()))
+			}
+		}
+	}()
+
+	// Copy to destination device: read from progress (which reads from sourceReader) and write to progress
+	_, err = io.Copy(progress, progress)
+
+	// Stop progress reporting
+	ticker.Stop()
+	done <- true
+
+	if err != nil {
+		return progress.writeBytes(), fmt.Errorf("failed to write layer to device: %w", err)
+	}
+
+	// A decompressor can stop reading before digestReader hits EOF: gzip's
+	// multistream read-ahead happens to drain it, but xz/zstd/bzip2 readers
+	// may consider themselves done once the logical stream ends without
+	// ever issuing the read that returns io.EOF. Drain digestReader
+	// explicitly so the digest comparison in its Read method always runs,
+	// for every compression format.
+	if _, err := io.Copy(io.Discard, digestReader); err != nil {
+		return progress.writeBytes(), fmt.Errorf("failed to verify layer %s: %w", layer.Digest, err)
+	}
+
+	return progress.writeBytes(), nil
+}
+
 func findDecompressor(imageURL string, r io.Reader) (io.ReadCloser, error) {
 	switch filepath.Ext(imageURL) {
 	case ".bzip2", ".bz2":
@@ -3,10 +3,12 @@ package image
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"io"
 	"strings"
 	"testing"
 
+	digest "github.com/opencontainers/go-digest"
 	"github.com/ulikunitz/xz"
 )
 
@@ -110,3 +112,37 @@ func Test_findDecompressor(t *testing.T) {
 		})
 	}
 }
+
+func Test_digestingReader(t *testing.T) {
+	data := []byte("YourDataHere")
+	good := digest.FromBytes(data)
+
+	t.Run("good digest", func(t *testing.T) {
+		r, err := newDigestingReader(bytes.NewReader(data), good)
+		if err != nil {
+			t.Fatalf("newDigestingReader() error = %v", err)
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			t.Fatalf("io.Copy() error = %v", err)
+		}
+	})
+
+	t.Run("wrong digest", func(t *testing.T) {
+		wrong := digest.FromBytes([]byte("SomethingElse"))
+		r, err := newDigestingReader(bytes.NewReader(data), wrong)
+		if err != nil {
+			t.Fatalf("newDigestingReader() error = %v", err)
+		}
+		_, err = io.Copy(io.Discard, r)
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("io.Copy() error = %v, want ErrDigestMismatch", err)
+		}
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		_, err := newDigestingReader(bytes.NewReader(data), digest.Digest("md5:deadbeef"))
+		if err == nil {
+			t.Error("newDigestingReader() error = nil, want error")
+		}
+	})
+}
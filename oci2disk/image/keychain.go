@@ -0,0 +1,170 @@
+package image
+
+// This file resolves registry credentials the same way the docker CLI does,
+// so private images can be pulled during provisioning.
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// Keychain resolves credentials for a registry host from docker's
+// config.json, trying in order: a per-registry credHelpers entry, a
+// per-registry entry under "auths", the credsStore credential helper, and
+// finally the REGISTRY_USERNAME/REGISTRY_PASSWORD environment variables.
+type Keychain struct {
+	configPaths []string
+}
+
+// NewDefaultKeychain returns a Keychain that reads the first of
+// $DOCKER_CONFIG/config.json and ~/.docker/config.json that exists.
+func NewDefaultKeychain() *Keychain {
+	var paths []string
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "config.json"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".docker", "config.json"))
+	}
+	return &Keychain{configPaths: paths}
+}
+
+// dockerConfig is the subset of ~/.docker/config.json this package understands.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+// load reads the first configured docker config.json that exists. A missing
+// config is not an error: it just means there are no file-based credentials.
+func (k *Keychain) load() (*dockerConfig, error) {
+	for _, path := range k.configPaths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read docker config %s: %w", path, err)
+		}
+
+		var cfg dockerConfig
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse docker config %s: %w", path, err)
+		}
+		return &cfg, nil
+	}
+	return &dockerConfig{}, nil
+}
+
+// dockerHubKey is the key docker CLI stores Docker Hub credentials under in
+// config.json, for historical reasons (it predates the docker.io hostname).
+const dockerHubKey = "https://index.docker.io/v1/"
+
+// dockerHubAliases are the hosts oras resolves Docker Hub references to.
+var dockerHubAliases = map[string]bool{
+	"docker.io":            true,
+	"registry-1.docker.io": true,
+	"index.docker.io":      true,
+}
+
+// Resolve implements auth.CredentialFunc, so a Keychain can be plugged
+// directly into an auth.Client.
+func (k *Keychain) Resolve(_ context.Context, registry string) (auth.Credential, error) {
+	cfg, err := k.load()
+	if err != nil {
+		return auth.EmptyCredential, err
+	}
+
+	for _, key := range lookupKeys(registry) {
+		if helper, ok := cfg.CredHelpers[key]; ok {
+			return credentialHelperGet(helper, key)
+		}
+		if entry, ok := cfg.Auths[key]; ok && entry.Auth != "" {
+			return decodeBasicAuth(entry.Auth)
+		}
+	}
+
+	if cfg.CredsStore != "" {
+		return credentialHelperGet(cfg.CredsStore, registry)
+	}
+
+	if user, pass := os.Getenv("REGISTRY_USERNAME"), os.Getenv("REGISTRY_PASSWORD"); user != "" || pass != "" {
+		return auth.Credential{Username: user, Password: pass}, nil
+	}
+
+	return auth.EmptyCredential, nil
+}
+
+// lookupKeys returns the config.json keys to try for registry, in order,
+// normalizing the Docker Hub aliases oras resolves references to ("docker.io",
+// "registry-1.docker.io") to the legacy key the docker CLI stores Docker Hub
+// credentials under, the same way authn.DefaultKeychain does.
+func lookupKeys(registry string) []string {
+	if dockerHubAliases[registry] {
+		return []string{registry, dockerHubKey}
+	}
+	return []string{registry}
+}
+
+func decodeBasicAuth(encoded string) (auth.Credential, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return auth.EmptyCredential, fmt.Errorf("failed to decode auth entry: %w", err)
+	}
+
+	user, pass, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return auth.EmptyCredential, fmt.Errorf("malformed auth entry")
+	}
+	return auth.Credential{Username: user, Password: pass}, nil
+}
+
+// credentialHelperOutput is the JSON a docker-credential-<helper> "get" call
+// writes to stdout.
+type credentialHelperOutput struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// credentialHelperNotFound is the error message docker-credential-helpers
+// return (via ErrCredentialsNotFound) when a host has no stored credentials.
+// The docker CLI treats this as "no credentials", not a hard failure, so that
+// pulling public images still works with a credsStore configured.
+const credentialHelperNotFound = "credentials not found in native keychain"
+
+// credentialHelperGet shells out to docker-credential-<helper>, writing the
+// registry host to its stdin as the docker credential-helper protocol requires.
+func credentialHelperGet(helper, registry string) (auth.Credential, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String(), credentialHelperNotFound) || strings.Contains(stderr.String(), credentialHelperNotFound) {
+			return auth.EmptyCredential, nil
+		}
+		return auth.EmptyCredential, fmt.Errorf("docker-credential-%s get %s: %w", helper, registry, err)
+	}
+
+	var out credentialHelperOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return auth.EmptyCredential, fmt.Errorf("failed to parse docker-credential-%s output: %w", helper, err)
+	}
+
+	return auth.Credential{Username: out.Username, Password: out.Secret}, nil
+}
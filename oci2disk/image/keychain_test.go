@@ -0,0 +1,89 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeychain_Resolve_auths(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("alice:hunter2"))
+	path := writeConfig(t, `{"auths":{"registry.example.com":{"auth":"`+encoded+`"}}}`)
+
+	k := &Keychain{configPaths: []string{path}}
+	cred, err := k.Resolve(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if cred.Username != "alice" || cred.Password != "hunter2" {
+		t.Errorf("Resolve() = %+v, want alice/hunter2", cred)
+	}
+}
+
+func TestKeychain_Resolve_noMatch(t *testing.T) {
+	path := writeConfig(t, `{"auths":{}}`)
+
+	k := &Keychain{configPaths: []string{path}}
+	cred, err := k.Resolve(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if cred != auth.EmptyCredential {
+		t.Errorf("Resolve() = %+v, want EmptyCredential", cred)
+	}
+}
+
+func TestKeychain_Resolve_envFallback(t *testing.T) {
+	path := writeConfig(t, `{"auths":{}}`)
+	t.Setenv("REGISTRY_USERNAME", "bob")
+	t.Setenv("REGISTRY_PASSWORD", "s3cret")
+
+	k := &Keychain{configPaths: []string{path}}
+	cred, err := k.Resolve(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if cred.Username != "bob" || cred.Password != "s3cret" {
+		t.Errorf("Resolve() = %+v, want bob/s3cret", cred)
+	}
+}
+
+func TestKeychain_Resolve_credHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper script is a shell script")
+	}
+
+	dir := t.TempDir()
+	helperPath := filepath.Join(dir, "docker-credential-test")
+	script := "#!/bin/sh\ncat <<'EOF'\n{\"ServerURL\":\"registry.example.com\",\"Username\":\"carol\",\"Secret\":\"topsecret\"}\nEOF\n"
+	if err := os.WriteFile(helperPath, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	path := writeConfig(t, `{"credHelpers":{"registry.example.com":"test"}}`)
+	k := &Keychain{configPaths: []string{path}}
+	cred, err := k.Resolve(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if cred.Username != "carol" || cred.Password != "topsecret" {
+		t.Errorf("Resolve() = %+v, want carol/topsecret", cred)
+	}
+}
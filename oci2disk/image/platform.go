@@ -0,0 +1,197 @@
+package image
+
+// This file implements explicit platform selection and manifest-index
+// introspection, so a caller provisioning a target of a different
+// architecture than the worker running oci2disk can say so rather than
+// relying on runtime.GOARCH. Matching is scored the way containerd's
+// platform matcher works, without taking on that package as a dependency.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+// ParsePlatform parses a platform string of the form "os/arch[/variant]",
+// e.g. "linux/amd64" or "linux/arm64/v8" - the same form containerd's
+// platforms.Parse accepts.
+func ParsePlatform(s string) (ocispec.Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return ocispec.Platform{}, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", s)
+	}
+
+	p := ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// platformString formats p the same way ParsePlatform expects, for use in
+// log messages and errors.
+func platformString(p ocispec.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// isIndexMediaType reports whether mediaType identifies a manifest index,
+// OCI or Docker's older equivalent manifest list.
+func isIndexMediaType(mediaType string) bool {
+	return mediaType == ocispec.MediaTypeImageIndex ||
+		mediaType == "application/vnd.docker.distribution.manifest.list.v2+json"
+}
+
+// platformScore reports how well candidate matches wanted, containerd-style:
+// OS and architecture must match (ignoring case) to be eligible at all; an exact
+// variant match scores higher than an unspecified one, and a matching
+// os.version or OS feature each add further points. ok is false if
+// candidate is not an eligible match.
+func platformScore(wanted, candidate ocispec.Platform) (score int, ok bool) {
+	if !strings.EqualFold(wanted.OS, candidate.OS) {
+		return 0, false
+	}
+	if !strings.EqualFold(wanted.Architecture, candidate.Architecture) {
+		return 0, false
+	}
+
+	switch {
+	case wanted.Variant == "" && candidate.Variant == "":
+		score += 10
+	case strings.EqualFold(wanted.Variant, candidate.Variant):
+		score += 10
+	case wanted.Variant == "" || candidate.Variant == "":
+		// One side leaves the variant unspecified: still a valid, if
+		// weaker, match than an outright mismatch below.
+	default:
+		return 0, false
+	}
+
+	if wanted.OSVersion != "" && wanted.OSVersion == candidate.OSVersion {
+		score++
+	}
+
+	wantFeatures := make(map[string]bool, len(wanted.OSFeatures))
+	for _, f := range wanted.OSFeatures {
+		wantFeatures[f] = true
+	}
+	for _, f := range candidate.OSFeatures {
+		if wantFeatures[f] {
+			score++
+		}
+	}
+
+	return score, true
+}
+
+// selectManifestForPlatform picks the entry from a manifest index whose
+// Platform best matches wanted, by platformScore. If none match, the
+// returned error lists every platform the index advertises.
+func selectManifestForPlatform(entries []ocispec.Descriptor, wanted ocispec.Platform) (ocispec.Descriptor, error) {
+	var (
+		best      ocispec.Descriptor
+		bestScore = -1
+		found     bool
+		available []ocispec.Platform
+	)
+
+	for _, e := range entries {
+		if e.Platform == nil {
+			continue
+		}
+		available = append(available, *e.Platform)
+
+		score, ok := platformScore(wanted, *e.Platform)
+		if !ok {
+			continue
+		}
+		if !found || score > bestScore {
+			best, bestScore, found = e, score, true
+		}
+	}
+
+	if !found {
+		return ocispec.Descriptor{}, fmt.Errorf("no manifest for platform %s found in index; available: %s",
+			platformString(wanted), platformListString(available))
+	}
+	return best, nil
+}
+
+func platformListString(platforms []ocispec.Platform) string {
+	parts := make([]string, len(platforms))
+	for i, p := range platforms {
+		parts[i] = platformString(p)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fetchIndexManifests fetches and parses the manifest index identified by
+// desc, returning its per-platform manifest entries.
+func fetchIndexManifests(ctx context.Context, src oras.ReadOnlyTarget, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	b, err := content.FetchAll(ctx, src, desc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest index: %w", err)
+	}
+
+	var index ocispec.Index
+	if err := json.Unmarshal(b, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest index: %w", err)
+	}
+	return index.Manifests, nil
+}
+
+// ListPlatforms returns the platforms ref's manifest index advertises. If
+// ref resolves directly to a single-platform manifest rather than an
+// index, ListPlatforms returns that manifest's platform alone, or an empty
+// slice if it doesn't declare one.
+func ListPlatforms(ref string) ([]ocispec.Platform, error) {
+	ctx := context.Background()
+
+	client := &auth.Client{
+		Client:     retry.DefaultClient,
+		Header:     http.Header{"User-Agent": {"oras-go"}},
+		Cache:      auth.DefaultCache,
+		Credential: NewDefaultKeychain().Resolve,
+	}
+
+	src, err := openSource(ctx, ref, client)
+	if err != nil {
+		return nil, err
+	}
+
+	desc, err := src.target.Resolve(ctx, src.ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve manifest: %w", err)
+	}
+
+	if !isIndexMediaType(desc.MediaType) {
+		if desc.Platform != nil {
+			return []ocispec.Platform{*desc.Platform}, nil
+		}
+		return nil, nil
+	}
+
+	entries, err := fetchIndexManifests(ctx, src.target, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	platforms := make([]ocispec.Platform, 0, len(entries))
+	for _, e := range entries {
+		if e.Platform != nil {
+			platforms = append(platforms, *e.Platform)
+		}
+	}
+	return platforms, nil
+}
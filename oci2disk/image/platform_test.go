@@ -0,0 +1,74 @@
+package image
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func Test_ParsePlatform(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    ocispec.Platform
+		wantErr bool
+	}{
+		{"os/arch", "linux/amd64", ocispec.Platform{OS: "linux", Architecture: "amd64"}, false},
+		{"os/arch/variant", "linux/arm64/v8", ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, false},
+		{"missing arch", "linux", ocispec.Platform{}, true},
+		{"too many parts", "linux/arm/v7/extra", ocispec.Platform{}, true},
+		{"empty arch", "linux/", ocispec.Platform{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePlatform(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePlatform(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePlatform(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectManifestForPlatform(t *testing.T) {
+	amd64 := ocispec.Descriptor{Digest: "sha256:amd64", Platform: &ocispec.Platform{OS: "linux", Architecture: "amd64"}}
+	armV7 := ocispec.Descriptor{Digest: "sha256:armv7", Platform: &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}}
+	armV6 := ocispec.Descriptor{Digest: "sha256:armv6", Platform: &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}}
+	entries := []ocispec.Descriptor{amd64, armV7, armV6}
+
+	t.Run("exact arch match", func(t *testing.T) {
+		got, err := selectManifestForPlatform(entries, ocispec.Platform{OS: "linux", Architecture: "amd64"})
+		if err != nil {
+			t.Fatalf("selectManifestForPlatform() error = %v", err)
+		}
+		if got.Digest != amd64.Digest {
+			t.Errorf("got %s, want %s", got.Digest, amd64.Digest)
+		}
+	})
+
+	t.Run("exact variant beats other variant", func(t *testing.T) {
+		got, err := selectManifestForPlatform(entries, ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"})
+		if err != nil {
+			t.Fatalf("selectManifestForPlatform() error = %v", err)
+		}
+		if got.Digest != armV7.Digest {
+			t.Errorf("got %s, want %s", got.Digest, armV7.Digest)
+		}
+	})
+
+	t.Run("no match lists available platforms", func(t *testing.T) {
+		_, err := selectManifestForPlatform(entries, ocispec.Platform{OS: "linux", Architecture: "riscv64"})
+		if err == nil {
+			t.Fatal("selectManifestForPlatform() error = nil, want error")
+		}
+		for _, want := range []string{"linux/amd64", "linux/arm/v7", "linux/arm/v6"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q does not mention %q", err, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package image
+
+// This file retries the network-touching steps of Write with exponential
+// backoff, since registries and blob stores occasionally fail transiently.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry/remote/errcode"
+)
+
+// Default backoff parameters applied to retried registry/blob operations
+// when Options doesn't override them.
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+	defaultMaxElapsedTime = 10 * time.Minute
+)
+
+func newBackOff(opts Options) *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = defaultInitialBackoff
+	b.MaxInterval = defaultMaxBackoff
+	b.MaxElapsedTime = defaultMaxElapsedTime
+
+	if opts.InitialBackoff > 0 {
+		b.InitialInterval = opts.InitialBackoff
+	}
+	if opts.MaxBackoff > 0 {
+		b.MaxInterval = opts.MaxBackoff
+	}
+	if opts.MaxElapsedTime > 0 {
+		b.MaxElapsedTime = opts.MaxElapsedTime
+	}
+
+	return b
+}
+
+// isPermanentError reports whether err is a failure that retrying will not
+// fix: a bad digest, a missing manifest, or an auth failure.
+func isPermanentError(err error) bool {
+	if errors.Is(err, ErrDigestMismatch) || errors.Is(err, errdef.ErrNotFound) {
+		return true
+	}
+
+	var errResp *errcode.ErrorResponse
+	if errors.As(err, &errResp) {
+		switch errResp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			return true
+		}
+	}
+
+	return false
+}
+
+// withRetry runs fn with exponential backoff, logging the attempt count and
+// next sleep on every failure. Errors classified as permanent by
+// isPermanentError are returned immediately without retrying.
+func withRetry(ctx context.Context, opts Options, description string, fn func() error) error {
+	attempt := 0
+
+	operation := func() error {
+		if err := ctx.Err(); err != nil {
+			return backoff.Permanent(err)
+		}
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if isPermanentError(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+
+	notify := func(err error, next time.Duration) {
+		attempt++
+		log.Warnf("%s failed on attempt %d: %v; retrying in %s", description, attempt, err, next)
+	}
+
+	return backoff.RetryNotify(operation, newBackOff(opts), notify)
+}
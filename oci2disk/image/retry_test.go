@@ -0,0 +1,70 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry/remote/errcode"
+)
+
+func Test_isPermanentError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"digest mismatch", ErrDigestMismatch, true},
+		{"not found", errdef.ErrNotFound, true},
+		{"401", &errcode.ErrorResponse{StatusCode: http.StatusUnauthorized}, true},
+		{"403", &errcode.ErrorResponse{StatusCode: http.StatusForbidden}, true},
+		{"404 response", &errcode.ErrorResponse{StatusCode: http.StatusNotFound}, true},
+		{"500", &errcode.ErrorResponse{StatusCode: http.StatusInternalServerError}, false},
+		{"generic", errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanentError(tt.err); got != tt.want {
+				t.Errorf("isPermanentError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_withRetry_retriesTransientThenSucceeds(t *testing.T) {
+	opts := Options{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	attempts := 0
+	err := withRetry(context.Background(), opts, "test op", func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withRetry() error = %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
+
+func Test_withRetry_stopsOnPermanentError(t *testing.T) {
+	opts := Options{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	attempts := 0
+	err := withRetry(context.Background(), opts, "test op", func() error {
+		attempts++
+		return ErrDigestMismatch
+	})
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("withRetry() error = %v, want ErrDigestMismatch", err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1 (no retry on permanent error)", attempts)
+	}
+}
@@ -0,0 +1,77 @@
+package image
+
+// This file dispatches a source image string to the transport its prefix
+// names, mirroring the docker://, oci:, and oci-archive: transports skopeo
+// exposes. A bare "registry/repo:tag" with no prefix is treated as docker://,
+// which keeps the previous default behavior working unchanged.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/oci"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+const (
+	dockerTransportPrefix     = "docker://"
+	ociTransportPrefix        = "oci://"
+	ociArchiveTransportPrefix = "oci-archive://"
+
+	// defaultTag is used when an oci:// or oci-archive:// source omits a tag.
+	defaultTag = "latest"
+)
+
+// resolvedSource bundles the target oras.Resolve and content.FetchAll should
+// operate against with the tag or digest to resolve within it.
+type resolvedSource struct {
+	target oras.ReadOnlyTarget
+	ref    string
+}
+
+// openSource opens sourceImage against the transport named by its prefix.
+// client is only used for the docker:// (remote registry) transport.
+func openSource(ctx context.Context, sourceImage string, client *auth.Client) (*resolvedSource, error) {
+	switch {
+	case strings.HasPrefix(sourceImage, ociArchiveTransportPrefix):
+		path, ref := splitPathAndTag(strings.TrimPrefix(sourceImage, ociArchiveTransportPrefix))
+		store, err := oci.NewFromTar(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open oci-archive %q: %w", path, err)
+		}
+		return &resolvedSource{target: store, ref: ref}, nil
+
+	case strings.HasPrefix(sourceImage, ociTransportPrefix):
+		path, ref := splitPathAndTag(strings.TrimPrefix(sourceImage, ociTransportPrefix))
+		store, err := oci.NewFromFS(ctx, os.DirFS(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open oci layout %q: %w", path, err)
+		}
+		return &resolvedSource{target: store, ref: ref}, nil
+
+	default:
+		ref := strings.TrimPrefix(sourceImage, dockerTransportPrefix)
+		repo, err := remote.NewRepository(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create repository: %w", err)
+		}
+		repo.Client = client
+		return &resolvedSource{target: repo, ref: repo.Reference.Reference}, nil
+	}
+}
+
+// splitPathAndTag splits "path[:tag]" into path and tag at the last colon
+// after the last slash. The tag is optional; when absent, defaultTag is
+// returned so callers can still resolve a single-image layout or archive
+// without requiring one. Digest references are not recognized: the colon
+// inside "sha256:..." is taken as the separator.
+func splitPathAndTag(pathAndTag string) (path, ref string) {
+	if idx := strings.LastIndex(pathAndTag, ":"); idx > strings.LastIndex(pathAndTag, "/") {
+		return pathAndTag[:idx], pathAndTag[idx+1:]
+	}
+	return pathAndTag, defaultTag
+}
@@ -0,0 +1,144 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/oci"
+)
+
+func Test_splitPathAndTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		wantPath string
+		wantRef  string
+	}{
+		{"with tag", "/var/lib/images/rootfs:v1", "/var/lib/images/rootfs", "v1"},
+		{"no tag", "/var/lib/images/rootfs", "/var/lib/images/rootfs", defaultTag},
+		{"relative no tag", "rootfs.tar", "rootfs.tar", defaultTag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, ref := splitPathAndTag(tt.in)
+			if path != tt.wantPath || ref != tt.wantRef {
+				t.Errorf("splitPathAndTag(%q) = (%q, %q), want (%q, %q)", tt.in, path, ref, tt.wantPath, tt.wantRef)
+			}
+		})
+	}
+}
+
+// newTestLayout creates an OCI image layout directory at dir containing a
+// single tagged manifest, and returns its descriptor.
+func newTestLayout(t *testing.T, dir, tag string) ocispec.Descriptor {
+	t.Helper()
+
+	store, err := oci.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := oras.TagBytes(context.Background(), store, "application/vnd.oci.image.manifest.v1+json", []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`), tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return desc
+}
+
+func tarDir(t *testing.T, dir, dest string) {
+	t.Helper()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	tw := tar.NewWriter(out)
+	defer tw.Close()
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_openSource_ociLayout(t *testing.T) {
+	dir := t.TempDir()
+	desc := newTestLayout(t, dir, "v1")
+
+	src, err := openSource(context.Background(), ociTransportPrefix+dir+":v1", nil)
+	if err != nil {
+		t.Fatalf("openSource() error = %v", err)
+	}
+	if src.ref != "v1" {
+		t.Errorf("ref = %q, want v1", src.ref)
+	}
+
+	resolved, err := src.target.Resolve(context.Background(), src.ref)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if resolved.Digest != desc.Digest {
+		t.Errorf("Resolve() digest = %s, want %s", resolved.Digest, desc.Digest)
+	}
+}
+
+func Test_openSource_ociArchive(t *testing.T) {
+	dir := t.TempDir()
+	desc := newTestLayout(t, dir, "v1")
+
+	archive := filepath.Join(t.TempDir(), "image.tar")
+	tarDir(t, dir, archive)
+
+	src, err := openSource(context.Background(), ociArchiveTransportPrefix+archive+":v1", nil)
+	if err != nil {
+		t.Fatalf("openSource() error = %v", err)
+	}
+
+	resolved, err := src.target.Resolve(context.Background(), src.ref)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if resolved.Digest != desc.Digest {
+		t.Errorf("Resolve() digest = %s, want %s", resolved.Digest, desc.Digest)
+	}
+}
+
+func Test_openSource_dockerDefault(t *testing.T) {
+	src, err := openSource(context.Background(), "docker://registry.example.com/repo:tag", nil)
+	if err != nil {
+		t.Fatalf("openSource() error = %v", err)
+	}
+	if src.ref != "tag" {
+		t.Errorf("ref = %q, want tag", src.ref)
+	}
+}